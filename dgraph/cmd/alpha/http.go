@@ -0,0 +1,364 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgraph/edgraph"
+	"github.com/dgraph-io/dgraph/gql"
+	"github.com/dgraph-io/dgraph/query"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// parseTsFromPath extracts an optional start timestamp that Dgraph clients
+// place at the end of /query, /mutate and /commit URLs, e.g. /query/123.
+func parseTsFromPath(r *http.Request, base string) (uint64, error) {
+	suffix := strings.TrimPrefix(r.URL.Path, base)
+	suffix = strings.Trim(suffix, "/")
+	if suffix == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(suffix, 10, 64)
+}
+
+// readRequestBody returns the request body, transparently decompressing it
+// when the client set Content-Encoding: gzip. Any other (or absent) value is
+// treated as identity, i.e. the body is read as-is.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	var rd io.Reader = r.Body
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "gzip":
+		gzr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, x.Errorf("unable to decompress gzip-encoded request body: %v", err)
+		}
+		defer gzr.Close()
+		rd = gzr
+	case "", "identity":
+		// Nothing to do.
+	}
+	return ioutil.ReadAll(rd)
+}
+
+// writeResponse marshals qr as JSON and writes it to w, gzip-compressing the
+// payload whenever the client sent Accept-Encoding: gzip.
+func writeResponse(w http.ResponseWriter, r *http.Request, qr *x.QueryResWithData) {
+	js, err := qr.ToJson()
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gzw := gzip.NewWriter(w)
+		defer gzw.Close()
+		x.Check2(gzw.Write(js))
+		return
+	}
+	x.Check2(w.Write(js))
+}
+
+// writeTimeoutError responds with HTTP 408 and a structured error in the
+// usual QueryResWithData envelope, so clients can keep parsing errors the
+// same way regardless of what caused the request to fail.
+func writeTimeoutError(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusRequestTimeout)
+	qr := &x.QueryResWithData{
+		Errors: []x.QueryResError{{Code: "ErrorTimeout", Message: msg}},
+	}
+	js, err := qr.ToJson()
+	if err != nil {
+		return
+	}
+	x.Check2(w.Write(js))
+}
+
+// requestTimeout parses the optional X-Dgraph-Timeout header (e.g. "5s",
+// "500ms"). An absent header means no deadline beyond the request's own
+// context.
+func requestTimeout(r *http.Request) (time.Duration, error) {
+	v := r.Header.Get("X-Dgraph-Timeout")
+	if v == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// withRequestTimeout derives a context from r that is cancelled when
+// X-Dgraph-Timeout elapses, in addition to the cancellation r.Context()
+// already carries when the client disconnects.
+func withRequestTimeout(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout, err := requestTimeout(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout <= 0 {
+		return r.Context(), func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// runWithDeadline executes fn in a goroutine and races it against ctx being
+// done. This borrows the cancel-channel-wired-to-a-context shape of
+// netstack's gonet deadlineTimer: instead of blocking on fn, we select
+// between its completion and ctx.Done(), so a timeout or client disconnect
+// aborts the wait immediately even though fn keeps running in the
+// background.
+func runWithDeadline(ctx context.Context, fn func() error) (timedOut bool, err error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case err := <-done:
+		return false, err
+	}
+}
+
+// ensureStartTs returns startTs unchanged when the caller already supplied
+// one, or synchronously allocates a fresh one otherwise. Doing this before
+// entering runWithDeadline means a later timeout always has a valid,
+// already-assigned timestamp to hand to edgraph.Abort — instead of racing
+// the in-flight mutate/commit call, which would otherwise only learn (and
+// report) the timestamp it was assigned after the deadline already fired.
+func ensureStartTs(ctx context.Context, startTs uint64) (uint64, error) {
+	if startTs != 0 {
+		return startTs, nil
+	}
+	return edgraph.NewStartTs(ctx)
+}
+
+// writeStartTsError reports a failure from ensureStartTs. A context-aware
+// allocation call (e.g. a gRPC round trip to the zero timestamp oracle) can
+// itself fail with ctx.Err() when X-Dgraph-Timeout has already elapsed —
+// that must still surface as the 408 the caller asked for, not a plain
+// 200-with-error, even though it happened before runWithDeadline ever got to
+// race anything. No ts was ever assigned, so there is nothing to abort.
+func writeStartTsError(w http.ResponseWriter, ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		writeTimeoutError(w, "could not allocate a start timestamp within X-Dgraph-Timeout")
+		return
+	}
+	x.SetStatus(w, x.Error, err.Error())
+}
+
+func queryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTs, err := parseTsFromPath(r, "/query")
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid start timestamp")
+		return
+	}
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid value for X-Dgraph-Timeout: "+err.Error())
+		return
+	}
+	defer cancel()
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	parsed, err := gql.Parse(gql.Request{Str: string(body)})
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	qr := query.Request{
+		GqlQuery:   &parsed,
+		Ctx:        ctx,
+		TsOverride: startTs,
+	}
+	var resp *x.QueryResWithData
+	timedOut, err := runWithDeadline(ctx, func() error {
+		var innerErr error
+		resp, innerErr = edgraph.Query(ctx, &qr)
+		return innerErr
+	})
+	if timedOut {
+		if startTs != 0 {
+			edgraph.Abort(startTs)
+		}
+		writeTimeoutError(w, "query did not complete within X-Dgraph-Timeout")
+		return
+	}
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+
+	writeResponse(w, r, resp)
+}
+
+func mutationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTs, err := parseTsFromPath(r, "/mutate")
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid start timestamp")
+		return
+	}
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid value for X-Dgraph-Timeout: "+err.Error())
+		return
+	}
+	defer cancel()
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	isJSON := r.Header.Get("X-Dgraph-MutationType") == "json"
+	commitNow := r.Header.Get("X-Dgraph-CommitNow") == "true"
+
+	startTs, err = ensureStartTs(ctx, startTs)
+	if err != nil {
+		writeStartTsError(w, ctx, err)
+		return
+	}
+
+	var resp *x.QueryResWithData
+	timedOut, err := runWithDeadline(ctx, func() error {
+		var innerErr error
+		resp, innerErr = edgraph.Mutate(ctx, &edgraph.MutationInput{
+			Body:      body,
+			IsJSON:    isJSON,
+			StartTs:   startTs,
+			CommitNow: commitNow,
+		})
+		return innerErr
+	})
+	if timedOut {
+		// startTs was assigned synchronously above, so it is always valid
+		// here, even for a request that did not supply one up front.
+		edgraph.Abort(startTs)
+		writeTimeoutError(w, "mutation did not complete within X-Dgraph-Timeout")
+		return
+	}
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+
+	writeResponse(w, r, resp)
+}
+
+func commitHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTs, err := parseTsFromPath(r, "/commit")
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid start timestamp")
+		return
+	}
+	if startTs == 0 {
+		// There is no implicit transaction to commit: /commit always
+		// finalizes one that a prior /mutate already started and returned a
+		// startTs for. Rejecting this up front also means the timeout path
+		// below never has to call edgraph.Abort with an unknown timestamp.
+		x.SetStatus(w, x.ErrorInvalidRequest, "/commit requires a start timestamp")
+		return
+	}
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid value for X-Dgraph-Timeout: "+err.Error())
+		return
+	}
+	defer cancel()
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	var resp *x.QueryResWithData
+	timedOut, err := runWithDeadline(ctx, func() error {
+		var innerErr error
+		resp, innerErr = edgraph.Commit(ctx, startTs, body)
+		return innerErr
+	})
+	if timedOut {
+		edgraph.Abort(startTs)
+		writeTimeoutError(w, "commit did not complete within X-Dgraph-Timeout")
+		return
+	}
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+
+	writeResponse(w, r, resp)
+}
+
+func alterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid value for X-Dgraph-Timeout: "+err.Error())
+		return
+	}
+	defer cancel()
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	var resp *x.QueryResWithData
+	timedOut, err := runWithDeadline(ctx, func() error {
+		var innerErr error
+		resp, innerErr = edgraph.Alter(ctx, body)
+		return innerErr
+	})
+	if timedOut {
+		writeTimeoutError(w, "alter did not complete within X-Dgraph-Timeout")
+		return
+	}
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+
+	writeResponse(w, r, resp)
+}
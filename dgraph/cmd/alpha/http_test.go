@@ -19,6 +19,7 @@ package alpha
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -115,13 +116,17 @@ func queryWithTs(q string, ts uint64) (string, uint64, error) {
 }
 
 func mutationWithTs(m string, isJson bool, commitNow bool, ignoreIndexConflict bool,
-	ts uint64) ([]string, uint64, error) {
+	ts uint64, compress bool) ([]string, uint64, error) {
 	url := addr + "/mutate"
 	if ts != 0 {
 		url += "/" + strconv.FormatUint(ts, 10)
 	}
 	var keys []string
-	req, err := http.NewRequest("POST", url, bytes.NewBufferString(m))
+	body, err := maybeGzipEncode([]byte(m), compress)
+	if err != nil {
+		return keys, 0, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
 		return keys, 0, err
 	}
@@ -132,18 +137,39 @@ func mutationWithTs(m string, isJson bool, commitNow bool, ignoreIndexConflict b
 	if commitNow {
 		req.Header.Set("X-Dgraph-CommitNow", "true")
 	}
-	_, body, err := runRequest(req)
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	_, respBody, err := runRequest(req)
 	if err != nil {
 		return keys, 0, err
 	}
 
 	var r res
-	x.Check(json.Unmarshal(body, &r))
+	x.Check(json.Unmarshal(respBody, &r))
 	startTs := r.Extensions.Txn.StartTs
 
 	return r.Extensions.Txn.Keys, startTs, nil
 }
 
+// maybeGzipEncode gzip-compresses body when compress is set, otherwise it
+// returns body unchanged. It mirrors the Content-Encoding handling that
+// queryHandler, mutationHandler and alterHandler perform on the server side.
+func maybeGzipEncode(body []byte, compress bool) ([]byte, error) {
+	if !compress {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func runRequest(req *http.Request) (*x.QueryResWithData, []byte, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -212,7 +238,7 @@ func TestTransactionBasic(t *testing.T) {
 	}
 	`
 
-	keys, mts, err := mutationWithTs(m1, false, false, true, ts)
+	keys, mts, err := mutationWithTs(m1, false, false, true, ts, false)
 	require.NoError(t, err)
 	require.Equal(t, mts, ts)
 	require.Equal(t, 3, len(keys))
@@ -296,3 +322,123 @@ func TestQueryCompression(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, resp.Header.Get("Content-Encoding"), "gzip")
 }
+
+func TestMutationRequestCompression(t *testing.T) {
+	require.NoError(t, dropAll())
+	require.NoError(t, alterSchema(`name: string @index(term) .`))
+
+	m1 := `
+	{
+	  set {
+		_:alice <name> "Alice" .
+	  }
+	}
+	`
+	// Uncompressed (identity) request body continues to work.
+	keys, ts, err := mutationWithTs(m1, false, true, true, 0, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(keys))
+	require.True(t, ts > 0)
+
+	// Gzip-encoded request body is transparently decompressed server-side.
+	m2 := `
+	{
+	  set {
+		_:bob <name> "Bob" .
+	  }
+	}
+	`
+	keys, ts, err = mutationWithTs(m2, false, true, true, 0, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(keys))
+	require.True(t, ts > 0)
+}
+
+func TestMutationMalformedGzip(t *testing.T) {
+	url := addr + "/mutate"
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString("not actually gzip"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var qr x.QueryResWithData
+	require.NoError(t, json.Unmarshal(body, &qr))
+	require.Len(t, qr.Errors, 1)
+}
+
+func TestQueryTimeoutExceeded(t *testing.T) {
+	req, err := http.NewRequest("POST", "/query", bytes.NewBufferString(`
+	{
+	  q(func: has(name)) {
+	    name
+	  }
+	}
+	`))
+	require.NoError(t, err)
+	req.Header.Set("X-Dgraph-Timeout", "1ns")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(queryHandler).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusRequestTimeout, rr.Code)
+
+	var qr x.QueryResWithData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &qr))
+	require.Len(t, qr.Errors, 1)
+}
+
+func TestQueryTimeoutParseError(t *testing.T) {
+	req, err := http.NewRequest("POST", "/query", bytes.NewBufferString(`{}`))
+	require.NoError(t, err)
+	req.Header.Set("X-Dgraph-Timeout", "not-a-duration")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(queryHandler).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var qr x.QueryResWithData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &qr))
+	require.Len(t, qr.Errors, 1)
+}
+
+func TestQueryClientCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequest("POST", "/query", bytes.NewBufferString(`
+	{
+	  q(func: has(name)) {
+	    name
+	  }
+	}
+	`))
+	require.NoError(t, err)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(queryHandler).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusRequestTimeout, rr.Code)
+}
+
+func TestMutationTimeoutExceeded(t *testing.T) {
+	m := `
+	{
+	  set {
+		_:a <name> "Whoever" .
+	  }
+	}
+	`
+	req, err := http.NewRequest("POST", "/mutate", bytes.NewBufferString(m))
+	require.NoError(t, err)
+	req.Header.Set("X-Dgraph-Timeout", "1ns")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(mutationHandler).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusRequestTimeout, rr.Code)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// authContextKey is the context key under which the decoded
+// authorizationResponse is stashed, so the query layer can later enforce the
+// allowed predicates/namespaces without re-parsing the upstream response.
+type authContextKey struct{}
+
+// authorizationResponse is the small JSON document the external auth
+// service is expected to return alongside a 200. It describes what the
+// caller is allowed to touch.
+type authorizationResponse struct {
+	AllowedPredicates []string `json:"allowed_predicates"`
+	AllowedNamespaces []uint64 `json:"allowed_namespaces"`
+}
+
+// authServiceURL points at the external authorization service consulted by
+// preAuthorizeHandler. It is bound to the --auth_service flag in run.go; an
+// empty value (the default) disables pre-authorization entirely so existing
+// deployments are unaffected.
+var authServiceURL string
+
+// authorizationFromContext returns the authorizationResponse stashed by
+// preAuthorizeHandler, if any.
+func authorizationFromContext(ctx context.Context) (*authorizationResponse, bool) {
+	authResp, ok := ctx.Value(authContextKey{}).(*authorizationResponse)
+	return authResp, ok
+}
+
+// preAuthorizeHandler wraps next with a call to the external authorization
+// service, mirroring gitlab-workhorse's preAuthorizeHandler(next, suffix):
+// the upstream service is asked about r.URL.Path+suffix together with the
+// incoming Authorization header, and next only runs on a 200 response. The
+// decoded authorizationResponse is stashed on the request context for next
+// to consult.
+func preAuthorizeHandler(next http.HandlerFunc, suffix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authServiceURL == "" {
+			next(w, r)
+			return
+		}
+
+		authReq, err := http.NewRequest(http.MethodGet, authServiceURL+r.URL.Path+suffix, nil)
+		if err != nil {
+			writeAuthError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		authReq.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+		resp, err := http.DefaultClient.Do(authReq)
+		if err != nil {
+			writeAuthError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		var authResp authorizationResponse
+		if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+			writeAuthError(w, http.StatusInternalServerError,
+				"malformed authorization response: "+err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authContextKey{}, &authResp)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// The *Authorized handlers are what run.go registers on the mux in place of
+// the bare handlers, so every /query, /mutate, /commit and /alter request
+// passes through preAuthorizeHandler before it reaches query execution.
+var (
+	queryHandlerAuthorized    = preAuthorizeHandler(queryHandler, "")
+	mutationHandlerAuthorized = preAuthorizeHandler(mutationHandler, "")
+	commitHandlerAuthorized   = preAuthorizeHandler(commitHandler, "")
+	alterHandlerAuthorized    = preAuthorizeHandler(alterHandler, "")
+)
+
+// writeAuthError responds with status and a structured error in the usual
+// QueryResWithData envelope.
+func writeAuthError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	qr := &x.QueryResWithData{
+		Errors: []x.QueryResError{{Code: "ErrorUnauthorized", Message: msg}},
+	}
+	js, err := qr.ToJson()
+	if err != nil {
+		return
+	}
+	x.Check2(w.Write(js))
+}
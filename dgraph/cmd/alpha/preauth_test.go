@@ -0,0 +1,132 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// withAuthServiceURL points authServiceURL at url for the duration of the
+// test and restores the previous value afterwards.
+func withAuthServiceURL(t *testing.T, url string) {
+	old := authServiceURL
+	authServiceURL = url
+	t.Cleanup(func() { authServiceURL = old })
+}
+
+func TestPreAuthorizeHappyPath(t *testing.T) {
+	authSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(authorizationResponse{
+			AllowedPredicates: []string{"name"},
+		})
+	}))
+	defer authSvc.Close()
+	withAuthServiceURL(t, authSvc.URL)
+
+	var calledWithAuth *authorizationResponse
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calledWithAuth, _ = authorizationFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+
+	req, err := http.NewRequest("POST", "/query", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	rr := httptest.NewRecorder()
+	preAuthorizeHandler(next, "").ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotNil(t, calledWithAuth)
+	require.Equal(t, []string{"name"}, calledWithAuth.AllowedPredicates)
+}
+
+func TestPreAuthorizeSuffix(t *testing.T) {
+	var gotPath string
+	authSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(authorizationResponse{})
+	}))
+	defer authSvc.Close()
+	withAuthServiceURL(t, authSvc.URL)
+
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	req, err := http.NewRequest("POST", "/mutate", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	preAuthorizeHandler(next, "/mutate").ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "/mutate/mutate", gotPath)
+}
+
+func TestPreAuthorizeJsonFailure(t *testing.T) {
+	authSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("not json"))
+	}))
+	defer authSvc.Close()
+	withAuthServiceURL(t, authSvc.URL)
+
+	nextCalled := false
+	next := func(w http.ResponseWriter, r *http.Request) { nextCalled = true }
+
+	req, err := http.NewRequest("POST", "/query", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	preAuthorizeHandler(next, "").ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	require.False(t, nextCalled)
+
+	var qr x.QueryResWithData
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &qr))
+	require.Len(t, qr.Errors, 1)
+}
+
+func TestPreAuthorizeForwardsUpstreamStatus(t *testing.T) {
+	authSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer authSvc.Close()
+	withAuthServiceURL(t, authSvc.URL)
+
+	nextCalled := false
+	next := func(w http.ResponseWriter, r *http.Request) { nextCalled = true }
+
+	req, err := http.NewRequest("POST", "/query", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	preAuthorizeHandler(next, "").ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.False(t, nextCalled)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"flag"
+	"net/http"
+)
+
+func init() {
+	flag.StringVar(&authServiceURL, "auth_service", "",
+		"URL of an external authorization service consulted before serving "+
+			"/query, /mutate, /commit, /alter and /txn requests. An empty "+
+			"value (the default) disables pre-authorization.")
+}
+
+// registerHTTPHandlers wires up the alpha HTTP surface on mux. Every
+// endpoint is registered through its preAuthorizeHandler-wrapped variant, so
+// pre-authorization actually runs in front of query execution rather than
+// being available but unused.
+func registerHTTPHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/query", queryHandlerAuthorized)
+	mux.HandleFunc("/query/", queryHandlerAuthorized)
+	mux.HandleFunc("/mutate", mutationHandlerAuthorized)
+	mux.HandleFunc("/mutate/", mutationHandlerAuthorized)
+	mux.HandleFunc("/commit", commitHandlerAuthorized)
+	mux.HandleFunc("/commit/", commitHandlerAuthorized)
+	mux.HandleFunc("/alter", alterHandlerAuthorized)
+	mux.HandleFunc("/txn", txnHandlerAuthorized)
+}
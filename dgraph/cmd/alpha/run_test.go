@@ -0,0 +1,50 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegisterHTTPHandlersUsesAuthorizedVariants guards against the mux
+// wiring regressing back to the bare handlers, which would make
+// preAuthorizeHandler dead code again.
+func TestRegisterHTTPHandlersUsesAuthorizedVariants(t *testing.T) {
+	authSvc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer authSvc.Close()
+	withAuthServiceURL(t, authSvc.URL)
+
+	mux := http.NewServeMux()
+	registerHTTPHandlers(mux)
+
+	req, err := http.NewRequest("POST", "/query", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	// A bare queryHandler would never call out to authServiceURL, so seeing
+	// the auth service's 403 forwarded here proves /query is served by
+	// queryHandlerAuthorized, not queryHandler directly.
+	require.Equal(t, http.StatusForbidden, rr.Code)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dgraph-io/dgraph/edgraph"
+	"github.com/dgraph-io/dgraph/gql"
+	"github.com/dgraph-io/dgraph/query"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// txnOp is a single operation inside a /txn request. Exactly one of Query or
+// Mutation should be set.
+type txnOp struct {
+	Query    string `json:"query,omitempty"`
+	Mutation string `json:"mutation,omitempty"`
+	IsJSON   bool   `json:"is_json,omitempty"`
+}
+
+// txnRequest is the JSON envelope accepted by /txn. It lets a client express
+// the queryWithTs -> mutationWithTs -> commitWithTs round trip demonstrated
+// in TestTransactionBasic as a single ordered batch executed under one start
+// timestamp.
+type txnRequest struct {
+	StartTs   uint64  `json:"start_ts,omitempty"`
+	Ops       []txnOp `json:"ops"`
+	CommitNow bool    `json:"commit_now,omitempty"`
+}
+
+// txnOpResult is the per-op slice of a /txn response, in the same order as
+// the request's Ops.
+type txnOpResult struct {
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// txnResponse is the body returned by /txn: per-op results plus the usual
+// Extensions.Txn block, so conflict-detection keys and the commit timestamp
+// are reported exactly as they would be for three separate requests.
+type txnResponse struct {
+	Ops        []txnOpResult     `json:"ops"`
+	Extensions *query.Extensions `json:"extensions,omitempty"`
+}
+
+// txnHandler executes a batch of queries and mutations under a single start
+// timestamp, optionally committing at the end, so clients can express
+// upserts atomically without a query -> mutate -> commit round trip per
+// operation.
+func txnHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Invalid value for X-Dgraph-Timeout: "+err.Error())
+		return
+	}
+	defer cancel()
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	var req txnRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		x.SetStatus(w, x.ErrorInvalidRequest, "Malformed /txn request: "+err.Error())
+		return
+	}
+
+	// Assign startTs synchronously, before the batch races against ctx, so
+	// it is already known and stable by the time a timeout or a mid-batch
+	// failure needs to abort it — no op below ever reassigns it, which would
+	// otherwise race the goroutine below against the timeout/error checks
+	// that read startTs after runWithDeadline returns.
+	startTs, err := ensureStartTs(ctx, req.StartTs)
+	if err != nil {
+		writeStartTsError(w, ctx, err)
+		return
+	}
+
+	var opResults []txnOpResult
+	var allKeys []string
+
+	timedOut, opErr := runWithDeadline(ctx, func() error {
+		for _, op := range req.Ops {
+			switch {
+			case op.Query != "":
+				parsed, perr := gql.Parse(gql.Request{Str: op.Query})
+				if perr != nil {
+					return perr
+				}
+				qr := query.Request{GqlQuery: &parsed, Ctx: ctx, TsOverride: startTs}
+				resp, qerr := edgraph.Query(ctx, &qr)
+				if qerr != nil {
+					return qerr
+				}
+				opResults = append(opResults, txnOpResult{Data: resp.Data})
+
+			case op.Mutation != "":
+				resp, merr := edgraph.Mutate(ctx, &edgraph.MutationInput{
+					Body:      []byte(op.Mutation),
+					IsJSON:    op.IsJSON,
+					StartTs:   startTs,
+					CommitNow: false,
+				})
+				if merr != nil {
+					return merr
+				}
+				allKeys = append(allKeys, resp.Extensions.Txn.Keys...)
+				opResults = append(opResults, txnOpResult{Data: resp.Data})
+
+			default:
+				return x.Errorf("txn op must set either query or mutation")
+			}
+		}
+		return nil
+	})
+	if timedOut {
+		edgraph.Abort(startTs)
+		writeTimeoutError(w, "txn did not complete within X-Dgraph-Timeout")
+		return
+	}
+	if opErr != nil {
+		// One or more earlier ops in this batch may have already run against
+		// the store under startTs. Since we're not committing, abort that
+		// partial work instead of leaving it dangling, and report the
+		// failure instead of the truncated results.
+		edgraph.Abort(startTs)
+		x.SetStatus(w, x.Error, opErr.Error())
+		return
+	}
+
+	txn := &query.TxnContext{StartTs: startTs, Keys: dedupeKeys(allKeys)}
+	if req.CommitNow {
+		keysJSON, merr := json.Marshal(txn.Keys)
+		if merr != nil {
+			x.SetStatus(w, x.Error, merr.Error())
+			return
+		}
+		commitResp, err := edgraph.Commit(ctx, startTs, keysJSON)
+		if err != nil {
+			x.SetStatus(w, x.Error, err.Error())
+			return
+		}
+		txn.CommitTs = commitResp.Extensions.Txn.CommitTs
+	}
+
+	resp := &txnResponse{
+		Ops:        opResults,
+		Extensions: &query.Extensions{Txn: txn},
+	}
+	js, err := json.Marshal(resp)
+	if err != nil {
+		x.SetStatus(w, x.Error, err.Error())
+		return
+	}
+	x.Check2(w.Write(js))
+}
+
+// txnHandlerAuthorized is the preAuthorizeHandler-wrapped variant registered
+// on the mux, consistent with the other endpoints in run.go.
+var txnHandlerAuthorized = preAuthorizeHandler(txnHandler, "")
+
+// dedupeKeys merges the conflict-detection keys returned by each mutation op
+// so commit sees every key exactly once, the same way a client merges keys
+// across several mutationWithTs calls before calling commitWithTs.
+func dedupeKeys(keys []string) []string {
+	seen := make(map[string]struct{}, len(keys))
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		out = append(out, k)
+	}
+	return out
+}
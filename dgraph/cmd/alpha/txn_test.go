@@ -0,0 +1,159 @@
+/*
+ * Copyright 2017-2018 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alpha
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func doTxn(req txnRequest) (*txnResponse, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest("POST", addr+"/txn", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	_, body, err := runRequest(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	var resp txnResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func TestTransactionBatch(t *testing.T) {
+	require.NoError(t, dropAll())
+	require.NoError(t, alterSchema(`name: string @index(term) .`))
+
+	resp, err := doTxn(txnRequest{
+		CommitNow: true,
+		Ops: []txnOp{
+			{Mutation: `
+			{
+			  set {
+				_:alice <name> "Alice" .
+				_:alice <balance> "110" .
+				_:bob <balance> "60" .
+			  }
+			}
+			`},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp.Extensions)
+	require.NotNil(t, resp.Extensions.Txn)
+	require.True(t, resp.Extensions.Txn.StartTs > 0)
+	require.True(t, resp.Extensions.Txn.CommitTs > 0)
+
+	q1 := `
+	{
+	  balances(func: anyofterms(name, "Alice Bob")) {
+	    name
+	    balance
+	  }
+	}
+	`
+	data, _, err := queryWithTs(q1, 0)
+	require.NoError(t, err)
+	require.Equal(t, `{"data":{"balances":[{"name":"Alice","balance":"110"}]}}`, data)
+}
+
+func TestTransactionBatchMergesKeysAcrossOps(t *testing.T) {
+	require.NoError(t, dropAll())
+	require.NoError(t, alterSchema(`name: string @index(term) .`))
+
+	resp, err := doTxn(txnRequest{
+		CommitNow: true,
+		Ops: []txnOp{
+			{Mutation: `{ set { _:a <name> "Alice" . } }`},
+			{Mutation: `{ set { _:b <name> "Bob" . } }`},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Ops, 2)
+	// Keys from both mutations are merged into a single conflict-detection
+	// set for the shared commit, rather than being tracked per-op.
+	require.True(t, len(resp.Extensions.Txn.Keys) >= 2)
+}
+
+func TestTxnRegisteredOnMux(t *testing.T) {
+	mux := http.NewServeMux()
+	registerHTTPHandlers(mux)
+
+	b, err := json.Marshal(txnRequest{})
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", "/txn", bytes.NewReader(b))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	// An empty batch is a valid (if pointless) request; getting anything
+	// other than a 404 here proves /txn is actually wired into the mux.
+	require.NotEqual(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTxnTimeoutExceededDuringStartTsAllocation(t *testing.T) {
+	b, err := json.Marshal(txnRequest{
+		CommitNow: true,
+		Ops:       []txnOp{{Mutation: `{ set { _:a <name> "Whoever" . } }`}},
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/txn", bytes.NewReader(b))
+	require.NoError(t, err)
+	req.Header.Set("X-Dgraph-Timeout", "1ns")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(txnHandler).ServeHTTP(rr, req)
+
+	// X-Dgraph-Timeout expires before ensureStartTs even runs, so this must
+	// surface as the 408 the header asked for, not a plain 200-with-error.
+	require.Equal(t, http.StatusRequestTimeout, rr.Code)
+}
+
+func TestTransactionBatchAbortsOnMidBatchFailure(t *testing.T) {
+	require.NoError(t, dropAll())
+	require.NoError(t, alterSchema(`name: string @index(term) .`))
+
+	_, err := doTxn(txnRequest{
+		CommitNow: true,
+		Ops: []txnOp{
+			{Mutation: `{ set { _:a <name> "ShouldNotBeCommitted" . } }`},
+			{}, // neither Query nor Mutation set: the batch must fail here.
+		},
+	})
+	require.Error(t, err)
+
+	// The first op ran against the store under the shared startTs, but since
+	// the batch as a whole failed, it must have been aborted rather than
+	// partially committed.
+	data, _, err := queryWithTs(`{ q(func: has(name)) { name } }`, 0)
+	require.NoError(t, err)
+	require.Equal(t, `{"data":{"q":[]}}`, data)
+}